@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// specDiff reports whether a single stmtSpec's reduced grammar changed
+// between two sql.y sources, which production lines were added or removed,
+// and which nonterminals the inlined grammar newly reaches.
+type specDiff struct {
+	Name    string   `json:"name"`
+	Changed bool     `json:"changed"`
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+	// NewlyReachable lists nonterminals referenced by the new reduced
+	// grammar that weren't referenced by the old one - typically the
+	// result of an inline expansion (s.inline) pulling in a production
+	// that previously wasn't part of this spec's reachable grammar.
+	NewlyReachable []string `json:"newly_reachable,omitempty"`
+}
+
+// reduceSpec runs the same inline/extract/replace pipeline used by the root
+// generator against a single BNF source, producing the reduced grammar for
+// one spec.
+func reduceSpec(bnf []byte, s stmtSpec) ([]byte, error) {
+	if s.stmt == "" {
+		s.stmt = s.name
+	}
+	g, err := runParse(bytes.NewReader(bnf), s.inline, s.stmt, false, s.match, s.exclude)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range s.replace {
+		g = bytes.Replace(g, []byte(r.from), []byte(r.to), -1)
+	}
+	return g, nil
+}
+
+// lineDiff returns the lines present in b but not a, and the lines present
+// in a but not b.
+func lineDiff(a, b []byte) (added, removed []string) {
+	count := func(lines []string) map[string]int {
+		m := make(map[string]int, len(lines))
+		for _, l := range lines {
+			m[l]++
+		}
+		return m
+	}
+	split := func(b []byte) []string {
+		s := strings.Split(string(b), "\n")
+		out := s[:0]
+		for _, l := range s {
+			if strings.TrimSpace(l) != "" {
+				out = append(out, l)
+			}
+		}
+		return out
+	}
+
+	aLines, bLines := split(a), split(b)
+	aCount, bCount := count(aLines), count(bLines)
+
+	for _, l := range bLines {
+		if aCount[l] == 0 {
+			added = append(added, l)
+		}
+	}
+	for _, l := range aLines {
+		if bCount[l] == 0 {
+			removed = append(removed, l)
+		}
+	}
+	return added, removed
+}
+
+// nonterminalRefRe matches either a quoted literal (which it discards) or a
+// bare identifier, so that iterating over its captures yields exactly the
+// nonterminal references in an EBNF production body.
+var nonterminalRefRe = regexp.MustCompile(`'[^']*'|([A-Za-z_][A-Za-z0-9_]*)`)
+
+// referencedNonterminals returns the set of nonterminal names referenced
+// anywhere in a reduced EBNF grammar's production bodies (the right-hand
+// side of each "name ::= ..." line), ignoring quoted literals and
+// production names themselves.
+func referencedNonterminals(g []byte) map[string]bool {
+	refs := make(map[string]bool)
+	for _, line := range strings.Split(string(g), "\n") {
+		parts := strings.SplitN(line, "::=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		for _, m := range nonterminalRefRe.FindAllStringSubmatch(parts[1], -1) {
+			if m[1] != "" {
+				refs[m[1]] = true
+			}
+		}
+	}
+	return refs
+}
+
+// newlyReachable returns, sorted, the nonterminals referenced by newG but
+// not by oldG - the nonterminals an inline expansion newly exposes.
+func newlyReachable(oldG, newG []byte) []string {
+	oldRefs, newRefs := referencedNonterminals(oldG), referencedNonterminals(newG)
+	var out []string
+	for nt := range newRefs {
+		if !oldRefs[nt] {
+			out = append(out, nt)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// runDiff reduces each spec in specList against the old and new sql.y
+// sources and reports which ones changed.
+func runDiff(oldAddr, newAddr string, specList []stmtSpec) ([]specDiff, error) {
+	oldBNF, err := runBNF(oldAddr)
+	if err != nil {
+		return nil, fmt.Errorf("reading --old: %v", err)
+	}
+	newBNF, err := runBNF(newAddr)
+	if err != nil {
+		return nil, fmt.Errorf("reading --new: %v", err)
+	}
+
+	sorted := make([]stmtSpec, len(specList))
+	copy(sorted, specList)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].name < sorted[j].name })
+
+	var diffs []specDiff
+	for _, s := range sorted {
+		oldG, err := reduceSpec(oldBNF, s)
+		if err != nil {
+			return nil, fmt.Errorf("spec %s: reducing --old: %v", s.name, err)
+		}
+		newG, err := reduceSpec(newBNF, s)
+		if err != nil {
+			return nil, fmt.Errorf("spec %s: reducing --new: %v", s.name, err)
+		}
+		added, removed := lineDiff(oldG, newG)
+		diffs = append(diffs, specDiff{
+			Name:           s.name,
+			Changed:        len(added) > 0 || len(removed) > 0,
+			Added:          added,
+			Removed:        removed,
+			NewlyReachable: newlyReachable(oldG, newG),
+		})
+	}
+	return diffs, nil
+}
+
+// formatDiff renders the diff report in the requested format ("text" or
+// "json").
+func formatDiff(diffs []specDiff, format string) ([]byte, error) {
+	switch format {
+	case "json":
+		return json.MarshalIndent(diffs, "", "  ")
+	case "text", "":
+		var buf bytes.Buffer
+		for _, d := range diffs {
+			if !d.Changed {
+				continue
+			}
+			fmt.Fprintf(&buf, "%s: changed\n", d.Name)
+			for _, l := range d.Removed {
+				fmt.Fprintf(&buf, "  - %s\n", l)
+			}
+			for _, l := range d.Added {
+				fmt.Fprintf(&buf, "  + %s\n", l)
+			}
+			for _, nt := range d.NewlyReachable {
+				fmt.Fprintf(&buf, "  ~ %s (newly reachable)\n", nt)
+			}
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unknown format %q (want text or json)", format)
+	}
+}
+
+// anyChanged reports whether any spec in diffs changed.
+func anyChanged(diffs []specDiff) bool {
+	for _, d := range diffs {
+		if d.Changed {
+			return true
+		}
+	}
+	return false
+}
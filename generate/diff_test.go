@@ -0,0 +1,167 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLineDiff(t *testing.T) {
+	testCases := []struct {
+		name        string
+		a, b        string
+		wantAdded   []string
+		wantRemoved []string
+	}{
+		{
+			name: "no changes",
+			a:    "select_stmt ::= 'SELECT' target_list\n",
+			b:    "select_stmt ::= 'SELECT' target_list\n",
+		},
+		{
+			name:      "added only",
+			a:         "select_stmt ::= 'SELECT' target_list\n",
+			b:         "select_stmt ::= 'SELECT' target_list\nwhere_clause ::= 'WHERE' expr\n",
+			wantAdded: []string{"where_clause ::= 'WHERE' expr"},
+		},
+		{
+			name:        "removed only",
+			a:           "select_stmt ::= 'SELECT' target_list\nwhere_clause ::= 'WHERE' expr\n",
+			b:           "select_stmt ::= 'SELECT' target_list\n",
+			wantRemoved: []string{"where_clause ::= 'WHERE' expr"},
+		},
+		{
+			name:        "both",
+			a:           "select_stmt ::= 'SELECT' target_list\n",
+			b:           "select_stmt ::= 'SELECT' target_list2\n",
+			wantAdded:   []string{"select_stmt ::= 'SELECT' target_list2"},
+			wantRemoved: []string{"select_stmt ::= 'SELECT' target_list"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			added, removed := lineDiff([]byte(tc.a), []byte(tc.b))
+			if !reflect.DeepEqual(added, tc.wantAdded) {
+				t.Errorf("added = %v, want %v", added, tc.wantAdded)
+			}
+			if !reflect.DeepEqual(removed, tc.wantRemoved) {
+				t.Errorf("removed = %v, want %v", removed, tc.wantRemoved)
+			}
+		})
+	}
+}
+
+func TestNewlyReachable(t *testing.T) {
+	testCases := []struct {
+		name       string
+		oldG, newG string
+		want       []string
+	}{
+		{
+			name: "no new references",
+			oldG: "select_stmt ::= 'SELECT' target_list\n",
+			newG: "select_stmt ::= 'SELECT' target_list\n",
+			want: nil,
+		},
+		{
+			name: "inlining exposes a new nonterminal",
+			oldG: "select_stmt ::= 'SELECT' target_list\n",
+			newG: "select_stmt ::= 'SELECT' target_list where_clause\nwhere_clause ::= 'WHERE' expr\n",
+			want: []string{"expr", "where_clause"},
+		},
+		{
+			name: "literals never count as nonterminals",
+			oldG: "select_stmt ::= 'SELECT'\n",
+			newG: "select_stmt ::= 'SELECT' 'WHERE'\n",
+			want: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := newlyReachable([]byte(tc.oldG), []byte(tc.newG))
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAnyChanged(t *testing.T) {
+	if anyChanged(nil) {
+		t.Error("anyChanged(nil) = true, want false")
+	}
+	if anyChanged([]specDiff{{Name: "a", Changed: false}}) {
+		t.Error("anyChanged with no changed specs = true, want false")
+	}
+	if !anyChanged([]specDiff{{Name: "a", Changed: false}, {Name: "b", Changed: true}}) {
+		t.Error("anyChanged with a changed spec = false, want true")
+	}
+}
+
+func TestFormatDiff(t *testing.T) {
+	diffs := []specDiff{
+		{Name: "select_stmt", Changed: false},
+		{
+			Name:           "insert_stmt",
+			Changed:        true,
+			Added:          []string{"insert_stmt ::= 'INSERT' target_list"},
+			Removed:        []string{"insert_stmt ::= 'INSERT' target"},
+			NewlyReachable: []string{"target_list"},
+		},
+	}
+
+	t.Run("text", func(t *testing.T) {
+		out, err := formatDiff(diffs, "text")
+		if err != nil {
+			t.Fatalf("formatDiff: %v", err)
+		}
+		s := string(out)
+		if strings.Contains(s, "select_stmt") {
+			t.Errorf("unchanged spec should be omitted from text output: %s", s)
+		}
+		if !strings.Contains(s, "insert_stmt: changed") {
+			t.Errorf("missing changed header: %s", s)
+		}
+		if !strings.Contains(s, "- insert_stmt ::= 'INSERT' target") {
+			t.Errorf("missing removed line: %s", s)
+		}
+		if !strings.Contains(s, "+ insert_stmt ::= 'INSERT' target_list") {
+			t.Errorf("missing added line: %s", s)
+		}
+		if !strings.Contains(s, "~ target_list (newly reachable)") {
+			t.Errorf("missing newly reachable line: %s", s)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		out, err := formatDiff(diffs, "json")
+		if err != nil {
+			t.Fatalf("formatDiff: %v", err)
+		}
+		if !strings.Contains(string(out), `"newly_reachable"`) {
+			t.Errorf("json output missing newly_reachable field: %s", out)
+		}
+	})
+
+	t.Run("default format is text", func(t *testing.T) {
+		wantText, err := formatDiff(diffs, "text")
+		if err != nil {
+			t.Fatalf("formatDiff: %v", err)
+		}
+		gotDefault, err := formatDiff(diffs, "")
+		if err != nil {
+			t.Fatalf("formatDiff: %v", err)
+		}
+		if string(gotDefault) != string(wantText) {
+			t.Errorf("formatDiff with empty format = %q, want %q", gotDefault, wantText)
+		}
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		if _, err := formatDiff(diffs, "xml"); err == nil {
+			t.Fatal("formatDiff with unknown format: got nil error, want one")
+		}
+	})
+}
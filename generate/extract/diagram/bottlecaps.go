@@ -0,0 +1,50 @@
+package diagram
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/cockroachdb/docs/generate/extract"
+)
+
+// BottlecapsBackend generates SVG by shelling out to the bottlecaps.de
+// railroad diagram generator. This is the original behavior of the
+// generator and remains the default.
+type BottlecapsBackend struct{}
+
+// Generate implements Backend.
+func (BottlecapsBackend) Generate(ebnf []byte) ([]byte, error) {
+	s, err := bottlecapsHTML(ebnf)
+	if err != nil {
+		return nil, err
+	}
+	body, err := extract.ExtractTag(strings.NewReader(s), "svg")
+	return []byte(body), err
+}
+
+// GenerateOverview implements Backend. The bottlecaps.de page for a
+// multi-production grammar isn't a single <svg>, so instead of extracting
+// one tag, it pulls out the page body and drops the bottlecaps.de's own
+// trailing UI controls (everything after the first <hr/>), replacing them
+// with a short attribution line.
+func (BottlecapsBackend) GenerateOverview(ebnf []byte) ([]byte, error) {
+	s, err := bottlecapsHTML(ebnf)
+	if err != nil {
+		return nil, err
+	}
+	body, err := extract.InnerTag(strings.NewReader(s), "body")
+	if err != nil {
+		return nil, err
+	}
+	body = strings.SplitN(body, "<hr/>", 2)[0]
+	body += `<p>generated by <a href="http://www.bottlecaps.de/rr/ui">Railroad Diagram Generator</a></p>`
+	return []byte(body), nil
+}
+
+func bottlecapsHTML(ebnf []byte) (string, error) {
+	html, err := extract.GenerateRR(ebnf)
+	if err != nil {
+		return "", err
+	}
+	return extract.XHTMLtoHTML(bytes.NewReader(html))
+}
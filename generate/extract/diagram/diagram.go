@@ -0,0 +1,39 @@
+// Package diagram renders railroad diagrams from reduced EBNF grammar,
+// through a pluggable Backend. The default backend shells out to the
+// bottlecaps.de railroad generator (the historical behavior); the other
+// backends run entirely in-process so that doc builds don't need network
+// access.
+package diagram
+
+import "fmt"
+
+// Backend turns a reduced EBNF grammar for a single production into a
+// diagram. SVG backends return a standalone SVG document; text backends
+// (Mermaid, PlantUML) return diagram source suitable for embedding in
+// Markdown.
+type Backend interface {
+	Generate(ebnf []byte) ([]byte, error)
+
+	// GenerateOverview renders the same ebnf, which may describe several
+	// productions at once (e.g. the full stmt_block grammar), for embedding
+	// as a page fragment rather than as a single standalone diagram. Unlike
+	// Generate, its output is not expected to be a self-contained <svg>.
+	GenerateOverview(ebnf []byte) ([]byte, error)
+}
+
+// New returns the Backend named by --backend. The empty string selects the
+// historical bottlecaps.de backend.
+func New(name string) (Backend, error) {
+	switch name {
+	case "", "bottlecaps":
+		return BottlecapsBackend{}, nil
+	case "native":
+		return NativeBackend{}, nil
+	case "mermaid":
+		return MermaidBackend{}, nil
+	case "plantuml":
+		return PlantUMLBackend{}, nil
+	default:
+		return nil, fmt.Errorf("unknown diagram backend %q (want native, bottlecaps, mermaid, or plantuml)", name)
+	}
+}
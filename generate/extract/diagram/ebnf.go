@@ -0,0 +1,207 @@
+package diagram
+
+import (
+	"fmt"
+	"strings"
+)
+
+// node is a minimal EBNF AST shared by the backends that render diagrams
+// without shelling out: a production's right-hand side is a tree of
+// sequences, choices, optionals, and repetitions over terminals and
+// nonterminals.
+type node interface {
+	isNode()
+}
+
+// terminal is a literal token, e.g. 'SELECT'.
+type terminal struct{ text string }
+
+// nonterminal is a reference to another production, e.g. select_stmt.
+type nonterminal struct{ name string }
+
+// sequence is a list of nodes that appear one after another.
+type sequence struct{ items []node }
+
+// choice is a list of alternative nodes, exactly one of which is taken.
+type choice struct{ items []node }
+
+// optional wraps a node that may be skipped.
+type optional struct{ item node }
+
+// repeat wraps a node that may repeat zero or more times.
+type repeat struct{ item node }
+
+func (terminal) isNode()    {}
+func (nonterminal) isNode() {}
+func (sequence) isNode()    {}
+func (choice) isNode()      {}
+func (optional) isNode()    {}
+func (repeat) isNode()      {}
+
+// production is a single named rule: name ::= body.
+type production struct {
+	name string
+	body node
+}
+
+// parseEBNF parses reduced EBNF of the form produced by extract.Grammar's
+// ExtractProduction: one or more lines shaped like
+//
+//	name ::= term term | term ...
+//
+// where a term is a quoted literal, a bare identifier, a parenthesized
+// group, an optional `[ ... ]`, or a group followed by `...` for
+// repetition.
+func parseEBNF(b []byte) ([]production, error) {
+	var prods []production
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		parts := strings.SplitN(line, "::=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		name := strings.TrimSpace(parts[0])
+		p := &ebnfParser{s: strings.TrimSpace(parts[1])}
+		body, err := p.parseChoice()
+		if err != nil {
+			return nil, fmt.Errorf("production %s: %v", name, err)
+		}
+		prods = append(prods, production{name: name, body: body})
+	}
+	return prods, nil
+}
+
+// ebnfParser is a small recursive-descent parser over a single production's
+// right-hand side.
+type ebnfParser struct {
+	s   string
+	pos int
+}
+
+func (p *ebnfParser) skipSpace() {
+	for p.pos < len(p.s) && p.s[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func (p *ebnfParser) peek() byte {
+	if p.pos >= len(p.s) {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+func (p *ebnfParser) parseChoice() (node, error) {
+	var items []node
+	item, err := p.parseSequence()
+	if err != nil {
+		return nil, err
+	}
+	items = append(items, item)
+	for {
+		p.skipSpace()
+		if p.peek() != '|' {
+			break
+		}
+		p.pos++
+		item, err := p.parseSequence()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if len(items) == 1 {
+		return items[0], nil
+	}
+	return choice{items: items}, nil
+}
+
+func (p *ebnfParser) parseSequence() (node, error) {
+	var items []node
+	for {
+		p.skipSpace()
+		c := p.peek()
+		if c == 0 || c == '|' || c == ')' || c == ']' {
+			break
+		}
+		item, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if len(items) == 0 {
+		return sequence{}, nil
+	}
+	if len(items) == 1 {
+		return items[0], nil
+	}
+	return sequence{items: items}, nil
+}
+
+func (p *ebnfParser) parseFactor() (node, error) {
+	atom, err := p.parseAtom()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if strings.HasPrefix(p.s[p.pos:], "...") {
+		p.pos += 3
+		return repeat{item: atom}, nil
+	}
+	return atom, nil
+}
+
+func (p *ebnfParser) parseAtom() (node, error) {
+	p.skipSpace()
+	switch c := p.peek(); {
+	case c == '(':
+		p.pos++
+		inner, err := p.parseChoice()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if p.peek() != ')' {
+			return nil, fmt.Errorf("expected ')' at %d", p.pos)
+		}
+		p.pos++
+		return inner, nil
+	case c == '[':
+		p.pos++
+		inner, err := p.parseChoice()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if p.peek() != ']' {
+			return nil, fmt.Errorf("expected ']' at %d", p.pos)
+		}
+		p.pos++
+		return optional{item: inner}, nil
+	case c == '\'':
+		end := strings.IndexByte(p.s[p.pos+1:], '\'')
+		if end == -1 {
+			return nil, fmt.Errorf("unterminated literal at %d", p.pos)
+		}
+		text := p.s[p.pos+1 : p.pos+1+end]
+		p.pos += end + 2
+		return terminal{text: text}, nil
+	default:
+		start := p.pos
+		for p.pos < len(p.s) {
+			c := p.s[p.pos]
+			if c == ' ' || c == '|' || c == ')' || c == ']' || c == '(' || c == '[' {
+				break
+			}
+			p.pos++
+		}
+		if start == p.pos {
+			return nil, fmt.Errorf("unexpected character %q at %d", p.peek(), p.pos)
+		}
+		return nonterminal{name: p.s[start:p.pos]}, nil
+	}
+}
@@ -0,0 +1,96 @@
+package diagram
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseEBNF(t *testing.T) {
+	testCases := []struct {
+		name  string
+		input string
+		want  []production
+	}{
+		{
+			name:  "terminal sequence",
+			input: "select_stmt ::= 'SELECT' target_list",
+			want: []production{
+				{name: "select_stmt", body: sequence{items: []node{
+					terminal{text: "SELECT"},
+					nonterminal{name: "target_list"},
+				}}},
+			},
+		},
+		{
+			name:  "choice",
+			input: "bool_expr ::= 'TRUE' | 'FALSE'",
+			want: []production{
+				{name: "bool_expr", body: choice{items: []node{
+					terminal{text: "TRUE"},
+					terminal{text: "FALSE"},
+				}}},
+			},
+		},
+		{
+			name:  "optional",
+			input: "order_clause ::= 'ORDER' 'BY' expr ['ASC']",
+			want: []production{
+				{name: "order_clause", body: sequence{items: []node{
+					terminal{text: "ORDER"},
+					terminal{text: "BY"},
+					nonterminal{name: "expr"},
+					optional{item: terminal{text: "ASC"}},
+				}}},
+			},
+		},
+		{
+			name:  "repeat",
+			input: "target_list ::= (target ',')...",
+			want: []production{
+				{name: "target_list", body: repeat{item: sequence{items: []node{
+					nonterminal{name: "target"},
+					terminal{text: ","},
+				}}}},
+			},
+		},
+		{
+			name:  "multiple productions, blank lines ignored",
+			input: "a ::= 'x'\n\nb ::= 'y'\n",
+			want: []production{
+				{name: "a", body: terminal{text: "x"}},
+				{name: "b", body: terminal{text: "y"}},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseEBNF([]byte(tc.input))
+			if err != nil {
+				t.Fatalf("parseEBNF: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %#v, want %#v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseEBNFError(t *testing.T) {
+	testCases := []struct {
+		name  string
+		input string
+	}{
+		{name: "unterminated literal", input: "a ::= 'x"},
+		{name: "unclosed paren", input: "a ::= (x"},
+		{name: "unclosed bracket", input: "a ::= [x"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := parseEBNF([]byte(tc.input)); err == nil {
+				t.Fatalf("parseEBNF(%q): got nil error, want one", tc.input)
+			}
+		})
+	}
+}
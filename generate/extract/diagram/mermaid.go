@@ -0,0 +1,89 @@
+package diagram
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MermaidBackend emits Mermaid flowchart source for each production,
+// suitable for embedding directly in a Markdown doc page.
+type MermaidBackend struct{}
+
+// Generate implements Backend.
+func (MermaidBackend) Generate(ebnf []byte) ([]byte, error) {
+	prods, err := parseEBNF(ebnf)
+	if err != nil {
+		return nil, err
+	}
+	var out strings.Builder
+	for i, p := range prods {
+		if i > 0 {
+			out.WriteString("\n")
+		}
+		fmt.Fprintf(&out, "flowchart LR\n  %%%% %s\n", p.name)
+		g := &mermaidGen{}
+		start := g.nodeID("start")
+		fmt.Fprintf(&out, "  %s((start))\n", start)
+		exit := g.emit(&out, p.body, start)
+		end := g.nodeID("end")
+		fmt.Fprintf(&out, "  %s((end))\n", end)
+		fmt.Fprintf(&out, "  %s --> %s\n", exit, end)
+	}
+	return []byte(out.String()), nil
+}
+
+// GenerateOverview implements Backend. Generate already emits one flowchart
+// per production it's given, so the overview and single-diagram paths are
+// the same here.
+func (b MermaidBackend) GenerateOverview(ebnf []byte) ([]byte, error) {
+	return b.Generate(ebnf)
+}
+
+type mermaidGen struct{ n int }
+
+func (g *mermaidGen) nodeID(prefix string) string {
+	id := prefix + strconv.Itoa(g.n)
+	g.n++
+	return id
+}
+
+// emit writes Mermaid edges for n starting from the node "from" and returns
+// the id of the node representing n's exit point.
+func (g *mermaidGen) emit(out *strings.Builder, n node, from string) string {
+	switch v := n.(type) {
+	case terminal:
+		id := g.nodeID("n")
+		fmt.Fprintf(out, "  %s[%q]\n  %s --> %s\n", id, v.text, from, id)
+		return id
+	case nonterminal:
+		id := g.nodeID("n")
+		fmt.Fprintf(out, "  %s(%s)\n  %s --> %s\n", id, v.name, from, id)
+		return id
+	case sequence:
+		cur := from
+		for _, item := range v.items {
+			cur = g.emit(out, item, cur)
+		}
+		return cur
+	case choice:
+		join := g.nodeID("join")
+		fmt.Fprintf(out, "  %s{{ }}\n", join)
+		for _, item := range v.items {
+			end := g.emit(out, item, from)
+			fmt.Fprintf(out, "  %s --> %s\n", end, join)
+		}
+		return join
+	case optional:
+		end := g.emit(out, v.item, from)
+		join := g.nodeID("join")
+		fmt.Fprintf(out, "  %s{{ }}\n  %s --> %s\n  %s --> %s\n", join, end, join, from, join)
+		return join
+	case repeat:
+		end := g.emit(out, v.item, from)
+		fmt.Fprintf(out, "  %s -. repeat .-> %s\n", end, from)
+		return end
+	default:
+		return from
+	}
+}
@@ -0,0 +1,206 @@
+package diagram
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NativeBackend renders railroad diagrams entirely in Go: it walks the
+// parsed EBNF AST and lays it out with a simple algorithm (sequence =
+// horizontal concat, choice = vertical stack with entry/exit lines,
+// optional = parallel bypass line, repetition = back-arrow below). Text
+// width is measured with a fixed-advance font table rather than font
+// rasterization, so this backend needs no external dependency and works
+// offline.
+type NativeBackend struct{}
+
+// charWidth is the fixed advance width, in pixels, used to size boxes. It
+// approximates a monospace diagram font; exact kerning doesn't matter for
+// railroad diagrams.
+const charWidth = 8
+
+const (
+	boxHeight  = 26
+	padX       = 10
+	hGap       = 16 // horizontal gap between sequence items
+	vGap       = 12 // vertical gap between choice rows
+	loopHeight = 20 // vertical space reserved for a repeat's back-arrow
+)
+
+// box is a laid-out diagram fragment: svg is relative to its own (0,0)
+// origin at its top-left corner, with its entry/exit line at y = entryY.
+type box struct {
+	svg    string
+	width  int
+	height int
+	// entryY is the y-coordinate, within [0, height), of the horizontal
+	// line that enters and exits this box on the left and right edges.
+	entryY int
+}
+
+// Generate implements Backend.
+func (NativeBackend) Generate(ebnf []byte) ([]byte, error) {
+	prods, err := parseEBNF(ebnf)
+	if err != nil {
+		return nil, err
+	}
+	if len(prods) == 0 {
+		return nil, fmt.Errorf("no productions found")
+	}
+
+	var svgs []string
+	totalW, y := 0, 0
+	const titleH = 20
+	for _, p := range prods {
+		b := render(p.body)
+		label := fmt.Sprintf(`<text x="0" y="%d" font-family="monospace" font-size="12" font-weight="bold">%s</text>`, y+titleH-6, escape(p.name))
+		svgs = append(svgs, fmt.Sprintf(`<g transform="translate(0,%d)">%s</g>`, y, label))
+		svgs = append(svgs, fmt.Sprintf(`<g transform="translate(0,%d)">%s</g>`, y+titleH, b.svg))
+		if b.width > totalW {
+			totalW = b.width
+		}
+		y += titleH + b.height + vGap
+	}
+
+	const defs = `<defs><marker id="arrow" markerWidth="8" markerHeight="8" refX="4" refY="4" orient="auto"><path d="M0,0 L8,4 L0,8 z"/></marker></defs>`
+	doc := fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">%s%s</svg>`,
+		totalW+2*padX, y, totalW+2*padX, y, defs, strings.Join(svgs, ""))
+	return []byte(doc), nil
+}
+
+// GenerateOverview implements Backend. Generate already lays out every
+// production it's given into one document, so the overview and
+// single-diagram paths are the same here.
+func (b NativeBackend) GenerateOverview(ebnf []byte) ([]byte, error) {
+	return b.Generate(ebnf)
+}
+
+// render lays out n and returns a box whose svg draws it with its entry
+// line at (0, entryY) and exit line at (width, entryY).
+func render(n node) box {
+	switch v := n.(type) {
+	case terminal:
+		return renderLeaf(v.text, true)
+	case nonterminal:
+		return renderLeaf(v.name, false)
+	case sequence:
+		return renderSequence(v.items)
+	case choice:
+		return renderChoice(v.items)
+	case optional:
+		return renderChoice([]node{sequence{}, v.item})
+	case repeat:
+		return renderRepeat(v.item)
+	default:
+		return renderLeaf("?", false)
+	}
+}
+
+func renderLeaf(text string, literal bool) box {
+	w := len(text)*charWidth + 2*padX
+	shape := "rect"
+	rx := 0
+	if literal {
+		rx = boxHeight / 2
+	}
+	y := 0
+	svg := fmt.Sprintf(
+		`<line x1="0" y1="%d" x2="%d" y2="%d" stroke="black"/>`+
+			`<%s x="%d" y="%d" width="%d" height="%d" rx="%d" fill="white" stroke="black"/>`+
+			`<text x="%d" y="%d" font-family="monospace" font-size="12" text-anchor="middle">%s</text>`+
+			`<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="black"/>`,
+		boxHeight/2, w, boxHeight/2,
+		shape, 0, y, w, boxHeight, rx,
+		w/2, boxHeight/2+4, escape(text),
+		w, boxHeight/2, w, boxHeight/2,
+	)
+	return box{svg: svg, width: w, height: boxHeight, entryY: boxHeight / 2}
+}
+
+func renderSequence(items []node) box {
+	if len(items) == 0 {
+		// An empty sequence is just a straight line (used for the "skip"
+		// branch of an optional).
+		return box{svg: `<line x1="0" y1="0" x2="40" y2="0" stroke="black"/>`, width: 40, height: 1, entryY: 0}
+	}
+	children := make([]box, len(items))
+	maxEntry, maxBelow := 0, 0
+	for i, it := range items {
+		children[i] = render(it)
+		if children[i].entryY > maxEntry {
+			maxEntry = children[i].entryY
+		}
+		if below := children[i].height - children[i].entryY; below > maxBelow {
+			maxBelow = below
+		}
+	}
+	height := maxEntry + maxBelow
+	var parts []string
+	x := 0
+	for _, c := range children {
+		dy := maxEntry - c.entryY
+		parts = append(parts, fmt.Sprintf(`<g transform="translate(%d,%d)">%s</g>`, x, dy, c.svg))
+		x += c.width
+		if x != 0 {
+			parts = append(parts, fmt.Sprintf(`<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="black"/>`, x, maxEntry, x+hGap, maxEntry))
+		}
+		x += hGap
+	}
+	return box{svg: strings.Join(parts, ""), width: x - hGap, height: height, entryY: maxEntry}
+}
+
+func renderChoice(items []node) box {
+	children := make([]box, len(items))
+	maxWidth := 0
+	for i, it := range items {
+		children[i] = render(it)
+		if children[i].width > maxWidth {
+			maxWidth = children[i].width
+		}
+	}
+
+	var parts []string
+	y := 0
+	entries := make([]int, len(children))
+	for i, c := range children {
+		entries[i] = y + c.entryY
+		parts = append(parts, fmt.Sprintf(`<g transform="translate(%d,%d)">%s</g>`, branchPad, y, c.svg))
+		// pad short branches out to maxWidth so the exit lines line up.
+		if c.width < maxWidth {
+			parts = append(parts, fmt.Sprintf(`<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="black"/>`,
+				branchPad+c.width, y+c.entryY, branchPad+maxWidth, y+c.entryY))
+		}
+		y += c.height + vGap
+	}
+	height := y - vGap
+
+	// Entry/exit spine: the overall entry point is the middle branch.
+	mid := entries[len(entries)/2]
+	for _, e := range entries {
+		parts = append(parts, fmt.Sprintf(`<line x1="0" y1="%d" x2="%d" y2="%d" stroke="black"/>`, mid, branchPad, e))
+		parts = append(parts, fmt.Sprintf(`<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="black"/>`,
+			branchPad+maxWidth, e, branchPad+maxWidth+branchPad, mid))
+	}
+
+	return box{svg: strings.Join(parts, ""), width: maxWidth + 2*branchPad, height: height, entryY: mid}
+}
+
+const branchPad = 14
+
+func renderRepeat(n node) box {
+	fwd := render(n)
+	// The back-arrow is drawn below the forward path, connecting its exit
+	// back to its entry, per the repetition layout rule.
+	y := fwd.height + loopHeight
+	loop := fmt.Sprintf(
+		`<path d="M %d %d V %d H %d V %d" fill="none" stroke="black" marker-end="url(#arrow)"/>`,
+		fwd.width, fwd.entryY, y, 0, fwd.entryY,
+	)
+	svg := fmt.Sprintf(`<g transform="translate(0,0)">%s</g>%s`, fwd.svg, loop)
+	return box{svg: svg, width: fwd.width, height: fwd.height + loopHeight, entryY: fwd.entryY}
+}
+
+func escape(s string) string {
+	r := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "'", "&apos;", `"`, "&quot;")
+	return r.Replace(s)
+}
@@ -0,0 +1,109 @@
+package diagram
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderLeaf(t *testing.T) {
+	b := renderLeaf("SELECT", true)
+	wantWidth := len("SELECT")*charWidth + 2*padX
+	if b.width != wantWidth {
+		t.Errorf("got width %d, want %d", b.width, wantWidth)
+	}
+	if b.height != boxHeight {
+		t.Errorf("got height %d, want %d", b.height, boxHeight)
+	}
+	if b.entryY != boxHeight/2 {
+		t.Errorf("got entryY %d, want %d", b.entryY, boxHeight/2)
+	}
+	if !strings.Contains(b.svg, "SELECT") {
+		t.Errorf("svg missing label: %s", b.svg)
+	}
+}
+
+func TestRenderSequence(t *testing.T) {
+	items := []node{terminal{text: "A"}, terminal{text: "BB"}}
+	seq := renderSequence(items)
+	a := renderLeaf("A", true)
+	bb := renderLeaf("BB", true)
+	wantWidth := a.width + hGap + bb.width
+	if seq.width != wantWidth {
+		t.Errorf("got width %d, want %d", seq.width, wantWidth)
+	}
+	if seq.height != boxHeight {
+		t.Errorf("got height %d, want %d", seq.height, boxHeight)
+	}
+}
+
+func TestRenderSequenceEmpty(t *testing.T) {
+	b := renderSequence(nil)
+	if b.entryY != 0 {
+		t.Errorf("got entryY %d, want 0", b.entryY)
+	}
+}
+
+func TestRenderChoice(t *testing.T) {
+	items := []node{terminal{text: "A"}, terminal{text: "BB"}, terminal{text: "CCC"}}
+	c := renderChoice(items)
+	a := renderLeaf("A", true)
+	bb := renderLeaf("BB", true)
+	ccc := renderLeaf("CCC", true)
+	maxWidth := a.width
+	if bb.width > maxWidth {
+		maxWidth = bb.width
+	}
+	if ccc.width > maxWidth {
+		maxWidth = ccc.width
+	}
+	wantWidth := maxWidth + 2*branchPad
+	if c.width != wantWidth {
+		t.Errorf("got width %d, want %d", c.width, wantWidth)
+	}
+	wantHeight := a.height + bb.height + ccc.height + 2*vGap
+	if c.height != wantHeight {
+		t.Errorf("got height %d, want %d", c.height, wantHeight)
+	}
+}
+
+func TestRenderRepeat(t *testing.T) {
+	fwd := renderLeaf("X", true)
+	r := renderRepeat(terminal{text: "X"})
+	if r.width != fwd.width {
+		t.Errorf("got width %d, want %d", r.width, fwd.width)
+	}
+	wantHeight := fwd.height + loopHeight
+	if r.height != wantHeight {
+		t.Errorf("got height %d, want %d", r.height, wantHeight)
+	}
+	if r.entryY != fwd.entryY {
+		t.Errorf("got entryY %d, want %d", r.entryY, fwd.entryY)
+	}
+}
+
+func TestNativeBackendGenerate(t *testing.T) {
+	svg, err := NativeBackend{}.Generate([]byte("a ::= 'X' 'Y'\n"))
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if !strings.HasPrefix(string(svg), "<svg") {
+		t.Errorf("output doesn't start with <svg: %s", svg)
+	}
+	if !strings.Contains(string(svg), "</svg>") {
+		t.Errorf("output missing closing </svg>: %s", svg)
+	}
+}
+
+func TestNativeBackendGenerateEmpty(t *testing.T) {
+	if _, err := (NativeBackend{}).Generate([]byte("")); err == nil {
+		t.Fatal("Generate(\"\"): got nil error, want one for no productions")
+	}
+}
+
+func TestEscape(t *testing.T) {
+	got := escape(`<a & "b"> 'c'`)
+	want := "&lt;a &amp; &quot;b&quot;&gt; &apos;c&apos;"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
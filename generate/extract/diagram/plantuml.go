@@ -0,0 +1,68 @@
+package diagram
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PlantUMLBackend emits PlantUML activity-diagram source for each
+// production, suitable for embedding in a Markdown doc page via a
+// PlantUML-rendering pipeline.
+type PlantUMLBackend struct{}
+
+// Generate implements Backend.
+func (PlantUMLBackend) Generate(ebnf []byte) ([]byte, error) {
+	prods, err := parseEBNF(ebnf)
+	if err != nil {
+		return nil, err
+	}
+	var out strings.Builder
+	out.WriteString("@startuml\n")
+	for _, p := range prods {
+		fmt.Fprintf(&out, "partition %s {\n", p.name)
+		out.WriteString("start\n")
+		writePlantUML(&out, p.body)
+		out.WriteString("stop\n")
+		out.WriteString("}\n")
+	}
+	out.WriteString("@enduml\n")
+	return []byte(out.String()), nil
+}
+
+// GenerateOverview implements Backend. Generate already emits one partition
+// per production it's given, so the overview and single-diagram paths are
+// the same here.
+func (b PlantUMLBackend) GenerateOverview(ebnf []byte) ([]byte, error) {
+	return b.Generate(ebnf)
+}
+
+func writePlantUML(out *strings.Builder, n node) {
+	switch v := n.(type) {
+	case terminal:
+		fmt.Fprintf(out, ":%s;\n", v.text)
+	case nonterminal:
+		fmt.Fprintf(out, ":%s;\n", v.name)
+	case sequence:
+		for _, item := range v.items {
+			writePlantUML(out, item)
+		}
+	case choice:
+		for i, item := range v.items {
+			if i == 0 {
+				out.WriteString("if () then\n")
+			} else {
+				out.WriteString("elseif () then\n")
+			}
+			writePlantUML(out, item)
+		}
+		out.WriteString("endif\n")
+	case optional:
+		out.WriteString("if () then (yes)\n")
+		writePlantUML(out, v.item)
+		out.WriteString("endif\n")
+	case repeat:
+		out.WriteString("repeat\n")
+		writePlantUML(out, v.item)
+		out.WriteString("repeat while ()\n")
+	}
+}
@@ -0,0 +1,90 @@
+// Package specs loads declarative statement specifications describing which
+// productions of the SQL grammar to extract into railroad diagrams. This
+// lets docs contributors add or change diagrams by editing a YAML/TOML file
+// instead of recompiling the generate binary.
+package specs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Replacement is a single ordered string substitution applied to the
+// extracted grammar for a spec. Replacements are applied in the order they
+// appear so that order-dependent substitutions behave predictably.
+type Replacement struct {
+	From string `yaml:"from" toml:"from"`
+	To   string `yaml:"to" toml:"to"`
+}
+
+// Spec mirrors the fields of the generator's internal stmtSpec, but in a
+// form that can be decoded from a config file.
+type Spec struct {
+	Name    string        `yaml:"name" toml:"name"`
+	Stmt    string        `yaml:"stmt" toml:"stmt"`
+	Inline  []string      `yaml:"inline" toml:"inline"`
+	Replace []Replacement `yaml:"replace" toml:"replace"`
+	Match   string        `yaml:"match" toml:"match"`
+	Exclude string        `yaml:"exclude" toml:"exclude"`
+
+	// MatchRe and ExcludeRe hold the compiled forms of Match and Exclude,
+	// populated by Load.
+	MatchRe   *regexp.Regexp `yaml:"-" toml:"-"`
+	ExcludeRe *regexp.Regexp `yaml:"-" toml:"-"`
+}
+
+type file struct {
+	Specs []Spec `yaml:"specs" toml:"specs"`
+}
+
+// Load reads and validates a spec file. The format (YAML or TOML) is chosen
+// by the file's extension: ".yaml"/".yml" for YAML, ".toml" for TOML.
+func Load(path string) ([]Spec, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var f file
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(b, &f); err != nil {
+			return nil, fmt.Errorf("parsing %s: %v", path, err)
+		}
+	case ".toml":
+		if _, err := toml.Decode(string(b), &f); err != nil {
+			return nil, fmt.Errorf("parsing %s: %v", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("unrecognized spec file extension %q (want .yaml, .yml, or .toml)", ext)
+	}
+
+	for i := range f.Specs {
+		s := &f.Specs[i]
+		if s.Name == "" {
+			return nil, fmt.Errorf("spec %d: name is required", i)
+		}
+		if s.Match != "" {
+			re, err := regexp.Compile(s.Match)
+			if err != nil {
+				return nil, fmt.Errorf("spec %s: match: %v", s.Name, err)
+			}
+			s.MatchRe = re
+		}
+		if s.Exclude != "" {
+			re, err := regexp.Compile(s.Exclude)
+			if err != nil {
+				return nil, fmt.Errorf("spec %s: exclude: %v", s.Name, err)
+			}
+			s.ExcludeRe = re
+		}
+	}
+
+	return f.Specs, nil
+}
@@ -0,0 +1,125 @@
+package specs
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	testCases := []struct {
+		name    string
+		file    string
+		content string
+		wantErr string
+		check   func(t *testing.T, specs []Spec)
+	}{
+		{
+			name: "yaml",
+			file: "specs.yaml",
+			content: `
+specs:
+  - name: select_stmt
+    stmt: select_stmt
+    inline: [select_clause]
+    match: '^foo'
+    exclude: '^bar'
+    replace:
+      - from: a
+        to: b
+`,
+			check: func(t *testing.T, specs []Spec) {
+				if len(specs) != 1 {
+					t.Fatalf("got %d specs, want 1", len(specs))
+				}
+				s := specs[0]
+				if s.Name != "select_stmt" || s.Stmt != "select_stmt" {
+					t.Errorf("got name=%q stmt=%q", s.Name, s.Stmt)
+				}
+				if len(s.Inline) != 1 || s.Inline[0] != "select_clause" {
+					t.Errorf("got inline=%v", s.Inline)
+				}
+				if s.MatchRe == nil || !s.MatchRe.MatchString("foobar") {
+					t.Errorf("MatchRe not compiled correctly: %v", s.MatchRe)
+				}
+				if s.ExcludeRe == nil || !s.ExcludeRe.MatchString("barbaz") {
+					t.Errorf("ExcludeRe not compiled correctly: %v", s.ExcludeRe)
+				}
+				if len(s.Replace) != 1 || s.Replace[0].From != "a" || s.Replace[0].To != "b" {
+					t.Errorf("got replace=%v", s.Replace)
+				}
+			},
+		},
+		{
+			name: "toml",
+			file: "specs.toml",
+			content: `
+[[specs]]
+name = "insert_stmt"
+stmt = "insert_stmt"
+`,
+			check: func(t *testing.T, specs []Spec) {
+				if len(specs) != 1 || specs[0].Name != "insert_stmt" {
+					t.Fatalf("got %v", specs)
+				}
+			},
+		},
+		{
+			name: "missing name",
+			file: "specs.yaml",
+			content: `
+specs:
+  - stmt: select_stmt
+`,
+			wantErr: "name is required",
+		},
+		{
+			name: "invalid match regexp",
+			file: "specs.yaml",
+			content: `
+specs:
+  - name: select_stmt
+    match: '('
+`,
+			wantErr: "match:",
+		},
+		{
+			name: "invalid exclude regexp",
+			file: "specs.yaml",
+			content: `
+specs:
+  - name: select_stmt
+    exclude: '('
+`,
+			wantErr: "exclude:",
+		},
+		{
+			name:    "unrecognized extension",
+			file:    "specs.ini",
+			content: "",
+			wantErr: "unrecognized spec file extension",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tc.file)
+			if err := ioutil.WriteFile(path, []byte(tc.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			specs, err := Load(path)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("got err=%v, want to contain %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			tc.check(t, specs)
+		})
+	}
+}
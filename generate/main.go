@@ -9,10 +9,13 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"strings"
 	"sync"
 
 	"github.com/cockroachdb/docs/generate/extract"
+	"github.com/cockroachdb/docs/generate/extract/diagram"
+	"github.com/cockroachdb/docs/generate/extract/specs"
 	"github.com/spf13/cobra"
 )
 
@@ -54,7 +57,10 @@ func main() {
 		}
 	}
 
-	var addr string
+	var (
+		addr      string
+		specsPath string
+	)
 
 	cmdBNF := &cobra.Command{
 		Use:   "bnf",
@@ -93,11 +99,17 @@ func main() {
 	cmdParse.Flags().BoolVar(&descend, "descend", true, "Descend past -stmt.")
 	cmdParse.Flags().StringSliceVar(&inline, "inline", nil, "List of statements to inline.")
 
+	var backendName string
+
 	cmdRR := &cobra.Command{
 		Use:   "rr",
 		Short: "Generate railroad diagram from stdin, writes to stdout",
 		Run: func(cmd *cobra.Command, args []string) {
-			b, err := runRR(read())
+			backend, err := diagram.New(backendName)
+			if err != nil {
+				log.Fatal(err)
+			}
+			b, err := runRR(read(), backend)
 			if err != nil {
 				log.Fatal(err)
 			}
@@ -105,6 +117,8 @@ func main() {
 		},
 	}
 
+	cmdRR.Flags().StringVar(&backendName, "backend", "", "Diagram backend: native, bottlecaps, mermaid, or plantuml. Defaults to bottlecaps.")
+
 	cmdBody := &cobra.Command{
 		Use:   "body",
 		Short: "Extract HTML <body> contents from stdin, writes to stdout",
@@ -117,6 +131,66 @@ func main() {
 		},
 	}
 
+	var listenAddr string
+
+	cmdServe := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve a live grammar browser over HTTP",
+		Long:  "Starts an HTTP server for iterating on sql.y locally: /grammar.html, /diagram/{name}.svg, /bnf, and POST /reduce.",
+		Run: func(cmd *cobra.Command, args []string) {
+			specList, err := loadSpecList(specsPath)
+			if err != nil {
+				log.Fatal(err)
+			}
+			backend, err := diagram.New(backendName)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if err := runServe(addr, listenAddr, specList, backend); err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+
+	cmdServe.Flags().StringVar(&addr, "addr", "https://raw.githubusercontent.com/cockroachdb/cockroach/master/sql/parser/sql.y", "Location of sql.y file. Can also specify a local file.")
+	cmdServe.Flags().StringVar(&specsPath, "specs", "", "Path to a YAML or TOML file declaring statement specs. Defaults to the built-in spec list.")
+	cmdServe.Flags().StringVar(&listenAddr, "listen", ":8080", "Address to listen on.")
+	cmdServe.Flags().StringVar(&backendName, "backend", "", "Diagram backend: native, bottlecaps, mermaid, or plantuml. Defaults to bottlecaps.")
+
+	var (
+		diffOld, diffNew string
+		diffFormat       string
+	)
+
+	cmdDiff := &cobra.Command{
+		Use:   "diff",
+		Short: "Report which statement diagrams changed between two sql.y sources",
+		Long:  "Reduces each statement spec against --old and --new and reports which ones changed. Exits nonzero if any did, so CI can gate on it.",
+		Run: func(cmd *cobra.Command, args []string) {
+			specList, err := loadSpecList(specsPath)
+			if err != nil {
+				log.Fatal(err)
+			}
+			diffs, err := runDiff(diffOld, diffNew, specList)
+			if err != nil {
+				log.Fatal(err)
+			}
+			out, err := formatDiff(diffs, diffFormat)
+			if err != nil {
+				log.Fatal(err)
+			}
+			write(out)
+			if anyChanged(diffs) {
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmdDiff.Flags().StringVar(&diffOld, "old", "", "Old sql.y source: path or URL.")
+	cmdDiff.Flags().StringVar(&diffNew, "new", "", "New sql.y source: path or URL.")
+	cmdDiff.Flags().StringVar(&diffFormat, "format", "text", "Report format: text or json.")
+	cmdDiff.Flags().StringVar(&specsPath, "specs", "", "Path to a YAML or TOML file declaring statement specs. Defaults to the built-in spec list.")
+
 	cmdFuncs := &cobra.Command{
 		Use:   "funcs",
 		Short: "Generates functions.md and operators.md",
@@ -126,7 +200,9 @@ func main() {
 	}
 
 	var (
-		baseDir string
+		baseDir  string
+		jobs     int
+		failFast bool
 	)
 
 	rootCmd := &cobra.Command{
@@ -134,6 +210,10 @@ func main() {
 		Short: "Generate SVG diagrams from SQL grammar",
 		Long:  `With no arguments, generates SQL diagrams for all statements.`,
 		Run: func(cmd *cobra.Command, args []string) {
+			backend, err := diagram.New(backendName)
+			if err != nil {
+				log.Fatal(err)
+			}
 			bnf, err := runBNF(addr)
 			if err != nil {
 				log.Fatal(err)
@@ -149,113 +229,160 @@ func main() {
 				if err != nil {
 					log.Fatal(err)
 				}
-				rr, err := runRR(bytes.NewReader(g))
-				if err != nil {
-					log.Fatal(err)
-				}
-				body, err := extract.InnerTag(bytes.NewReader(rr), "body")
-				body = strings.SplitN(body, "<hr/>", 2)[0]
-				body += `<p>generated by <a href="http://www.bottlecaps.de/rr/ui">Railroad Diagram Generator</a></p>`
-				body = fmt.Sprintf("<div>%s</div>", body)
+				rr, err := runOverview(bytes.NewReader(g), backend)
 				if err != nil {
 					log.Fatal(err)
 				}
+				body := fmt.Sprintf("<div>%s</div>", rr)
 				if err := ioutil.WriteFile(filepath.Join(baseDir, "grammar.html"), []byte(body), 0644); err != nil {
 					log.Fatal(err)
 				}
 			}()
 
-			specs := []stmtSpec{
-				// TODO(mjibson): improve SET filtering
-				// TODO(mjibson): improve SELECT display
-				{name: "alter_table_stmt", inline: []string{"alter_table_cmds", "alter_table_cmd", "column_def", "opt_drop_behavior", "alter_column_default", "opt_column", "opt_set_data"}},
-				{name: "begin_transaction", stmt: "transaction_stmt", inline: []string{"opt_transaction", "opt_transaction_mode_list", "transaction_iso_level", "transaction_user_priority"}, match: regexp.MustCompile("'BEGIN'")},
-				{name: "commit_transaction", stmt: "transaction_stmt", inline: []string{"opt_transaction"}, match: regexp.MustCompile("'COMMIT'")},
-				{name: "create_database_stmt"},
-				{name: "create_index_stmt", inline: []string{"opt_unique", "opt_name", "index_params"}},
-				{name: "create_table_stmt", inline: []string{"opt_table_elem_list", "table_elem_list", "table_elem"}},
-				{name: "delete_stmt", inline: []string{"relation_expr_opt_alias", "where_clause", "returning_clause", "target_list", "target_elem"}},
-				{name: "drop_database", stmt: "drop_stmt", match: regexp.MustCompile("'DROP' 'DATABASE'")},
-				{name: "drop_index", stmt: "drop_stmt", match: regexp.MustCompile("'DROP' 'INDEX'"), inline: []string{"opt_drop_behavior"}},
-				{name: "drop_stmt", inline: []string{"any_name_list", "any_name", "qualified_name_list", "qualified_name"}},
-				{name: "drop_table", stmt: "drop_stmt", match: regexp.MustCompile("'DROP' 'TABLE'")},
-				{name: "explain_stmt", inline: []string{"explainable_stmt", "explain_option_list"}},
-				{name: "grant_stmt", inline: []string{"privileges", "privilege_list", "privilege", "privilege_target", "grantee_list"}},
-				{name: "insert_stmt", inline: []string{"insert_target", "insert_rest", "returning_clause"}},
-				{name: "release_savepoint", stmt: "release_stmt", inline: []string{"savepoint_name"}},
-				{name: "rename_column", stmt: "rename_stmt", match: regexp.MustCompile("'ALTER' 'TABLE' .* 'RENAME' opt_column")},
-				{name: "rename_database", stmt: "rename_stmt", match: regexp.MustCompile("'ALTER' 'DATABASE'")},
-				{name: "rename_index", stmt: "rename_stmt", match: regexp.MustCompile("'ALTER' 'INDEX'")},
-				{name: "rename_table", stmt: "rename_stmt", match: regexp.MustCompile("'ALTER' 'TABLE' .* 'RENAME' 'TO'")},
-				{name: "revoke_stmt", inline: []string{"privileges", "privilege_list", "privilege", "privilege_target", "grantee_list"}},
-				{name: "rollback_transaction", stmt: "transaction_stmt", inline: []string{"opt_transaction"}, match: regexp.MustCompile("'ROLLBACK'")},
-				{name: "savepoint_stmt", inline: []string{"savepoint_name"}},
-				{name: "select_stmt", inline: []string{"select_no_parens", "simple_select", "opt_sort_clause", "select_limit"}},
-				{name: "set_stmt", inline: []string{"set_rest", "set_rest_more", "generic_set"}, exclude: regexp.MustCompile("CHARACTERISTICS"), replace: map[string]string{"'TRANSACTION' transaction_mode_list | ": ""}},
-				{name: "set_transaction", stmt: "set_stmt", inline: []string{"set_rest", "transaction_mode_list", "transaction_iso_level", "transaction_user_priority"}, replace: map[string]string{" | set_rest_more": ""}, match: regexp.MustCompile("'TRANSACTION'")},
-				{name: "show_columns", stmt: "show_stmt", match: regexp.MustCompile("'SHOW' 'COLUMNS'")},
-				{name: "show_databases", stmt: "show_stmt", match: regexp.MustCompile("'SHOW' 'DATABASES'")},
-				{name: "show_grants", stmt: "show_stmt", inline: []string{"on_privilege_target_clause", "privilege_target", "for_grantee_clause", "grantee_list"}, match: regexp.MustCompile("'SHOW' 'GRANTS'")},
-				{name: "show_index", stmt: "show_stmt", match: regexp.MustCompile("'SHOW' 'INDEX'")},
-				{name: "show_keys", stmt: "show_stmt", match: regexp.MustCompile("'SHOW' 'KEYS'")},
-				{name: "show_tables", stmt: "show_stmt", inline: []string{"opt_from_var_name_clause"}, match: regexp.MustCompile("'SHOW' 'TABLES'")},
-				{name: "show_timezone", stmt: "show_stmt", match: regexp.MustCompile("'SHOW' 'TIME' 'ZONE'")},
-				{name: "show_transaction", stmt: "show_stmt", match: regexp.MustCompile("'SHOW' 'TRANSACTION'")},
-				{name: "truncate_stmt", inline: []string{"opt_table", "relation_expr_list", "relation_expr"}},
-				{name: "update_stmt", inline: []string{"relation_expr_opt_alias", "set_clause_list", "set_clause", "single_set_clause", "multiple_set_clause", "ctext_row", "ctext_expr_list", "ctext_expr", "from_clause", "from_list", "where_clause", "returning_clause"}},
-				{name: "values", stmt: "values_clause", inline: []string{"ctext_row", "ctext_expr_list", "ctext_expr"}},
+			specList, err := loadSpecList(specsPath)
+			if err != nil {
+				log.Fatal(err)
 			}
 
-			for _, spec := range specs {
-				wg.Add(1)
-				go func(s stmtSpec) {
-					defer wg.Done()
-					if s.stmt == "" {
-						s.stmt = s.name
-					}
-					g, err := runParse(br(), s.inline, s.stmt, false, s.match, s.exclude)
-					if err != nil {
-						log.Fatal(err)
-					}
-					for from, to := range s.replace {
-						g = bytes.Replace(g, []byte(from), []byte(to), -1)
-					}
-					rr, err := runRR(bytes.NewReader(g))
-					if err != nil {
-						log.Fatal(err)
-					}
-					body, err := extract.ExtractTag(bytes.NewReader(rr), "svg")
-					if err != nil {
-						log.Fatal(err)
-					}
-					body = strings.Replace(body, `<a xlink:href="#`, `<a xlink:href="sql-grammar.html#`, -1)
-					name := strings.Replace(s.name, "_stmt", "", 1)
-					if err := ioutil.WriteFile(filepath.Join(baseDir, fmt.Sprintf("%s.html", name)), []byte(body), 0644); err != nil {
-						log.Fatal(err)
-					}
-				}(spec)
+			results, errs := runSpecPool(specList, jobs, failFast, func(s stmtSpec) ([]byte, error) {
+				if s.stmt == "" {
+					s.stmt = s.name
+				}
+				g, err := runParse(br(), s.inline, s.stmt, false, s.match, s.exclude)
+				if err != nil {
+					return nil, err
+				}
+				for _, r := range s.replace {
+					g = bytes.Replace(g, []byte(r.from), []byte(r.to), -1)
+				}
+				rr, err := runRR(bytes.NewReader(g), backend)
+				if err != nil {
+					return nil, err
+				}
+				body := strings.Replace(string(rr), `<a xlink:href="#`, `<a xlink:href="sql-grammar.html#`, -1)
+				return []byte(body), nil
+			})
+
+			// Write results out in the name-sorted order runSpecPool
+			// returned them, one at a time, so file timestamps are
+			// reproducible regardless of how --jobs workers finished.
+			for _, r := range results {
+				name := strings.Replace(r.name, "_stmt", "", 1)
+				if err := ioutil.WriteFile(filepath.Join(baseDir, fmt.Sprintf("%s.html", name)), r.body, 0644); err != nil {
+					log.Fatal(err)
+				}
 			}
+
 			wg.Wait()
+			reportSpecErrors(errs)
 		},
 	}
 
 	rootCmd.Flags().StringVar(&addr, "addr", "https://raw.githubusercontent.com/cockroachdb/cockroach/master/sql/parser/sql.y", "Location of sql.y file. Can also specify a local file.")
 	rootCmd.Flags().StringVar(&baseDir, "base", filepath.Join("..", "_includes", "sql", "diagrams"), "Base directory for html output.")
+	rootCmd.Flags().StringVar(&specsPath, "specs", "", "Path to a YAML or TOML file declaring statement specs. Defaults to the built-in spec list.")
+	rootCmd.Flags().StringVar(&backendName, "backend", "", "Diagram backend: native, bottlecaps, mermaid, or plantuml. Defaults to bottlecaps.")
+	rootCmd.Flags().IntVar(&jobs, "jobs", runtime.NumCPU(), "Number of specs to generate concurrently.")
+	rootCmd.Flags().BoolVar(&failFast, "fail-fast", false, "Abort on the first failing spec instead of reporting all failures.")
 
-	rootCmd.AddCommand(cmdBNF, cmdParse, cmdRR, cmdBody, cmdFuncs)
+	rootCmd.AddCommand(cmdBNF, cmdParse, cmdRR, cmdBody, cmdFuncs, cmdServe, cmdDiff)
 	rootCmd.PersistentFlags().StringVar(&outputPath, "out", "", "Output path; stdout if empty.")
 	rootCmd.PersistentFlags().StringVar(&inputPath, "in", "", "Input path; stdin if empty.")
 	rootCmd.Execute()
 }
 
+// defaultSpecs is the built-in list of statement specs used when no
+// --specs file is given.
+var defaultSpecs = []stmtSpec{
+	// TODO(mjibson): improve SET filtering
+	// TODO(mjibson): improve SELECT display
+	{name: "alter_table_stmt", inline: []string{"alter_table_cmds", "alter_table_cmd", "column_def", "opt_drop_behavior", "alter_column_default", "opt_column", "opt_set_data"}},
+	{name: "begin_transaction", stmt: "transaction_stmt", inline: []string{"opt_transaction", "opt_transaction_mode_list", "transaction_iso_level", "transaction_user_priority"}, match: regexp.MustCompile("'BEGIN'")},
+	{name: "commit_transaction", stmt: "transaction_stmt", inline: []string{"opt_transaction"}, match: regexp.MustCompile("'COMMIT'")},
+	{name: "create_database_stmt"},
+	{name: "create_index_stmt", inline: []string{"opt_unique", "opt_name", "index_params"}},
+	{name: "create_table_stmt", inline: []string{"opt_table_elem_list", "table_elem_list", "table_elem"}},
+	{name: "delete_stmt", inline: []string{"relation_expr_opt_alias", "where_clause", "returning_clause", "target_list", "target_elem"}},
+	{name: "drop_database", stmt: "drop_stmt", match: regexp.MustCompile("'DROP' 'DATABASE'")},
+	{name: "drop_index", stmt: "drop_stmt", match: regexp.MustCompile("'DROP' 'INDEX'"), inline: []string{"opt_drop_behavior"}},
+	{name: "drop_stmt", inline: []string{"any_name_list", "any_name", "qualified_name_list", "qualified_name"}},
+	{name: "drop_table", stmt: "drop_stmt", match: regexp.MustCompile("'DROP' 'TABLE'")},
+	{name: "explain_stmt", inline: []string{"explainable_stmt", "explain_option_list"}},
+	{name: "grant_stmt", inline: []string{"privileges", "privilege_list", "privilege", "privilege_target", "grantee_list"}},
+	{name: "insert_stmt", inline: []string{"insert_target", "insert_rest", "returning_clause"}},
+	{name: "release_savepoint", stmt: "release_stmt", inline: []string{"savepoint_name"}},
+	{name: "rename_column", stmt: "rename_stmt", match: regexp.MustCompile("'ALTER' 'TABLE' .* 'RENAME' opt_column")},
+	{name: "rename_database", stmt: "rename_stmt", match: regexp.MustCompile("'ALTER' 'DATABASE'")},
+	{name: "rename_index", stmt: "rename_stmt", match: regexp.MustCompile("'ALTER' 'INDEX'")},
+	{name: "rename_table", stmt: "rename_stmt", match: regexp.MustCompile("'ALTER' 'TABLE' .* 'RENAME' 'TO'")},
+	{name: "revoke_stmt", inline: []string{"privileges", "privilege_list", "privilege", "privilege_target", "grantee_list"}},
+	{name: "rollback_transaction", stmt: "transaction_stmt", inline: []string{"opt_transaction"}, match: regexp.MustCompile("'ROLLBACK'")},
+	{name: "savepoint_stmt", inline: []string{"savepoint_name"}},
+	{name: "select_stmt", inline: []string{"select_no_parens", "simple_select", "opt_sort_clause", "select_limit"}},
+	{name: "set_stmt", inline: []string{"set_rest", "set_rest_more", "generic_set"}, exclude: regexp.MustCompile("CHARACTERISTICS"), replace: []replacement{{from: "'TRANSACTION' transaction_mode_list | ", to: ""}}},
+	{name: "set_transaction", stmt: "set_stmt", inline: []string{"set_rest", "transaction_mode_list", "transaction_iso_level", "transaction_user_priority"}, replace: []replacement{{from: " | set_rest_more", to: ""}}, match: regexp.MustCompile("'TRANSACTION'")},
+	{name: "show_columns", stmt: "show_stmt", match: regexp.MustCompile("'SHOW' 'COLUMNS'")},
+	{name: "show_databases", stmt: "show_stmt", match: regexp.MustCompile("'SHOW' 'DATABASES'")},
+	{name: "show_grants", stmt: "show_stmt", inline: []string{"on_privilege_target_clause", "privilege_target", "for_grantee_clause", "grantee_list"}, match: regexp.MustCompile("'SHOW' 'GRANTS'")},
+	{name: "show_index", stmt: "show_stmt", match: regexp.MustCompile("'SHOW' 'INDEX'")},
+	{name: "show_keys", stmt: "show_stmt", match: regexp.MustCompile("'SHOW' 'KEYS'")},
+	{name: "show_tables", stmt: "show_stmt", inline: []string{"opt_from_var_name_clause"}, match: regexp.MustCompile("'SHOW' 'TABLES'")},
+	{name: "show_timezone", stmt: "show_stmt", match: regexp.MustCompile("'SHOW' 'TIME' 'ZONE'")},
+	{name: "show_transaction", stmt: "show_stmt", match: regexp.MustCompile("'SHOW' 'TRANSACTION'")},
+	{name: "truncate_stmt", inline: []string{"opt_table", "relation_expr_list", "relation_expr"}},
+	{name: "update_stmt", inline: []string{"relation_expr_opt_alias", "set_clause_list", "set_clause", "single_set_clause", "multiple_set_clause", "ctext_row", "ctext_expr_list", "ctext_expr", "from_clause", "from_list", "where_clause", "returning_clause"}},
+	{name: "values", stmt: "values_clause", inline: []string{"ctext_row", "ctext_expr_list", "ctext_expr"}},
+}
+
 type stmtSpec struct {
 	name           string
 	stmt           string // if unspecified, uses name
 	inline         []string
-	replace        map[string]string
+	replace        []replacement
 	match, exclude *regexp.Regexp
 }
 
+// replacement is an ordered string substitution applied to an extracted
+// grammar. Order matters: replacements are applied in sequence, so a later
+// entry can depend on an earlier one having already run.
+type replacement struct {
+	from, to string
+}
+
+// stmtSpecFromConfig converts a specs.Spec, as loaded from a user-provided
+// spec file, into the internal stmtSpec representation.
+func stmtSpecFromConfig(s specs.Spec) stmtSpec {
+	replace := make([]replacement, len(s.Replace))
+	for i, r := range s.Replace {
+		replace[i] = replacement{from: r.From, to: r.To}
+	}
+	return stmtSpec{
+		name:    s.Name,
+		stmt:    s.Stmt,
+		inline:  s.Inline,
+		replace: replace,
+		match:   s.MatchRe,
+		exclude: s.ExcludeRe,
+	}
+}
+
+// loadSpecList returns the built-in spec list, or the specs loaded from
+// specsPath if one is given.
+func loadSpecList(specsPath string) ([]stmtSpec, error) {
+	if specsPath == "" {
+		return defaultSpecs, nil
+	}
+	loaded, err := specs.Load(specsPath)
+	if err != nil {
+		return nil, err
+	}
+	specList := make([]stmtSpec, len(loaded))
+	for i, s := range loaded {
+		specList[i] = stmtSpecFromConfig(s)
+	}
+	return specList, nil
+}
+
 func runBNF(addr string) ([]byte, error) {
 	log.Printf("generate BNF: %s", addr)
 	return extract.GenerateBNF(addr)
@@ -265,24 +392,31 @@ func runParse(r io.Reader, inline []string, topStmt string, descend bool, match,
 	log.Printf("parse: %s, inline: %s, descend: %v", topStmt, inline, descend)
 	g, err := extract.ParseGrammar(r)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	if err := g.Inline(inline...); err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	return g.ExtractProduction(topStmt, descend, match, exclude)
 }
 
-func runRR(r io.Reader) ([]byte, error) {
+func runRR(r io.Reader, backend diagram.Backend) ([]byte, error) {
 	log.Printf("generate railroad diagrams")
 	b, err := ioutil.ReadAll(r)
 	if err != nil {
 		return nil, err
 	}
-	html, err := extract.GenerateRR(b)
+	return backend.Generate(b)
+}
+
+// runOverview is like runRR but for a grammar covering several productions
+// at once (e.g. the full stmt_block grammar for grammar.html), which isn't
+// rendered the same way as a single statement's diagram.
+func runOverview(r io.Reader, backend diagram.Backend) ([]byte, error) {
+	log.Printf("generate railroad diagram overview")
+	b, err := ioutil.ReadAll(r)
 	if err != nil {
 		return nil, err
 	}
-	s, err := extract.XHTMLtoHTML(bytes.NewReader(html))
-	return []byte(s), err
+	return backend.GenerateOverview(b)
 }
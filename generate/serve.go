@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/docs/generate/extract/diagram"
+)
+
+// fetchTTL bounds how often fetch re-reads sql.y. Without it, every request
+// to any handler would re-fetch (and, for a remote --addr, re-download)
+// sql.y, even though most requests arrive within milliseconds of each other
+// while a page loads its diagrams.
+const fetchTTL = 2 * time.Second
+
+// grammarServer serves the current grammar and derived diagrams over HTTP so
+// that grammar authors can iterate on sql.y locally and see diagrams refresh
+// without re-running the one-shot generator.
+type grammarServer struct {
+	addr     string
+	specList []stmtSpec
+	backend  diagram.Backend
+
+	mu        sync.Mutex
+	sha       string
+	bnf       []byte
+	fetchedAt time.Time
+	grammars  map[string][]byte // cache key: sha + "/" + "grammar.html" or "diagram/" + diagram name
+}
+
+func newGrammarServer(addr string, specList []stmtSpec, backend diagram.Backend) *grammarServer {
+	return &grammarServer{
+		addr:     addr,
+		specList: specList,
+		backend:  backend,
+		grammars: make(map[string][]byte),
+	}
+}
+
+// fetch returns the current sql.y BNF and its content hash. It re-reads
+// sql.y only when the last fetch is older than fetchTTL; callers within that
+// window get the last fetched copy. The actual I/O happens without s.mu held,
+// so one slow (or hung) fetch doesn't block every other handler - the lock is
+// only taken to read/update the cached copy and the sha compare-and-swap.
+// Callers that find the copy stale at the same time each re-read sql.y.
+func (s *grammarServer) fetch() ([]byte, string, error) {
+	s.mu.Lock()
+	if !s.fetchedAt.IsZero() && time.Since(s.fetchedAt) < fetchTTL {
+		bnf, sha := s.bnf, s.sha
+		s.mu.Unlock()
+		return bnf, sha, nil
+	}
+	s.mu.Unlock()
+
+	bnf, err := runBNF(s.addr)
+	if err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(bnf)
+	sha := hex.EncodeToString(sum[:])
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sha != s.sha {
+		s.sha = sha
+		s.bnf = bnf
+		s.grammars = make(map[string][]byte)
+	}
+	s.fetchedAt = time.Now()
+	return s.bnf, s.sha, nil
+}
+
+// cached returns the result of fn, memoized under key for as long as the
+// sql.y content hash doesn't change.
+func (s *grammarServer) cached(sha, key string, fn func() ([]byte, error)) ([]byte, error) {
+	s.mu.Lock()
+	if b, ok := s.grammars[sha+"/"+key]; ok {
+		s.mu.Unlock()
+		return b, nil
+	}
+	s.mu.Unlock()
+
+	b, err := fn()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.grammars[sha+"/"+key] = b
+	s.mu.Unlock()
+	return b, nil
+}
+
+func (s *grammarServer) handleBNF(w http.ResponseWriter, r *http.Request) {
+	bnf, sha, err := s.fetch()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("ETag", sha)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(bnf)
+}
+
+func (s *grammarServer) handleGrammarHTML(w http.ResponseWriter, r *http.Request) {
+	_, sha, err := s.fetch()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	body, err := s.cached(sha, "grammar.html", func() ([]byte, error) {
+		bnf, _, err := s.fetch()
+		if err != nil {
+			return nil, err
+		}
+		g, err := runParse(bytes.NewReader(bnf), nil, "stmt_block", true, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		rr, err := runOverview(bytes.NewReader(g), s.backend)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(fmt.Sprintf("<div>%s</div>", rr)), nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("ETag", sha)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(body)
+}
+
+func (s *grammarServer) specByName(name string) (stmtSpec, bool) {
+	for _, spec := range s.specList {
+		if strings.Replace(spec.name, "_stmt", "", 1) == name {
+			return spec, true
+		}
+	}
+	return stmtSpec{}, false
+}
+
+func (s *grammarServer) handleDiagram(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/diagram/")
+	name = strings.TrimSuffix(name, ".svg")
+	spec, ok := s.specByName(name)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if spec.stmt == "" {
+		spec.stmt = spec.name
+	}
+
+	bnf, sha, err := s.fetch()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	svg, err := s.cached(sha, "diagram/"+name, func() ([]byte, error) {
+		g, err := runParse(bytes.NewReader(bnf), spec.inline, spec.stmt, false, spec.match, spec.exclude)
+		if err != nil {
+			return nil, err
+		}
+		for _, rep := range spec.replace {
+			g = bytes.Replace(g, []byte(rep.from), []byte(rep.to), -1)
+		}
+		rr, err := runRR(bytes.NewReader(g), s.backend)
+		if err != nil {
+			return nil, err
+		}
+		return rr, nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("ETag", sha)
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Write(svg)
+}
+
+type reduceRequest struct {
+	Stmt   string   `json:"stmt"`
+	Inline []string `json:"inline"`
+}
+
+func (s *grammarServer) handleReduce(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req reduceRequest
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Stmt == "" {
+		http.Error(w, "stmt is required", http.StatusBadRequest)
+		return
+	}
+
+	bnf, _, err := s.fetch()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	g, err := runParse(bytes.NewReader(bnf), req.Inline, req.Stmt, false, nil, nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(g)
+}
+
+func (s *grammarServer) mux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/grammar.html", s.handleGrammarHTML)
+	mux.HandleFunc("/diagram/", s.handleDiagram)
+	mux.HandleFunc("/bnf", s.handleBNF)
+	mux.HandleFunc("/reduce", s.handleReduce)
+	return mux
+}
+
+// runServe starts the development HTTP server and blocks until it exits.
+func runServe(addr, listenAddr string, specList []stmtSpec, backend diagram.Backend) error {
+	s := newGrammarServer(addr, specList, backend)
+	log.Printf("serving grammar browser on %s", listenAddr)
+	return http.ListenAndServe(listenAddr, s.mux())
+}
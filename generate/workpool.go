@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+)
+
+// specError pairs a failing spec's name with the error it produced.
+type specError struct {
+	name string
+	err  error
+}
+
+// specResult pairs a successful spec's name with the output work produced
+// for it.
+type specResult struct {
+	name string
+	body []byte
+}
+
+// runSpecPool runs work for every spec in specList using at most jobs
+// concurrent workers. work must only compute output, not write it anywhere:
+// with jobs > 1, workers finish in scheduler-dependent order, so writing
+// files from inside work would make file timestamps depend on scheduling
+// rather than on spec name. Instead, runSpecPool collects every result and
+// returns both results and errors sorted by spec name, so a caller that
+// writes them out in that order gets reproducible file timestamps
+// regardless of jobs. If failFast is set, the first error aborts the
+// process immediately (the historical behavior); otherwise every spec runs
+// to completion and all failures are returned together so none are hidden
+// behind the first one.
+func runSpecPool(specList []stmtSpec, jobs int, failFast bool, work func(stmtSpec) ([]byte, error)) ([]specResult, []specError) {
+	sorted := make([]stmtSpec, len(specList))
+	copy(sorted, specList)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].name < sorted[j].name })
+
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	specCh := make(chan stmtSpec)
+	go func() {
+		defer close(specCh)
+		for _, s := range sorted {
+			specCh <- s
+		}
+	}()
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		results []specResult
+		errs    []specError
+	)
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for s := range specCh {
+				body, err := work(s)
+				if err != nil {
+					if failFast {
+						log.Fatalf("spec %s: %v", s.name, err)
+					}
+					mu.Lock()
+					errs = append(errs, specError{name: s.name, err: err})
+					mu.Unlock()
+					continue
+				}
+				mu.Lock()
+				results = append(results, specResult{name: s.name, body: body})
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool { return results[i].name < results[j].name })
+	sort.Slice(errs, func(i, j int) bool { return errs[i].name < errs[j].name })
+	return results, errs
+}
+
+// reportSpecErrors prints a consolidated report of every failing spec and
+// exits nonzero if there were any.
+func reportSpecErrors(errs []specError) {
+	if len(errs) == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%d spec(s) failed:\n", len(errs))
+	for _, e := range errs {
+		fmt.Fprintf(os.Stderr, "  %s: %v\n", e.name, e.err)
+	}
+	os.Exit(1)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRunSpecPool(t *testing.T) {
+	// Specs are listed out of name order on purpose so the test checks that
+	// both results and errors come back sorted by name.
+	specList := []stmtSpec{
+		{name: "select_stmt"},
+		{name: "alter_stmt"},
+		{name: "insert_stmt"},
+		{name: "drop_stmt"},
+		{name: "create_stmt"},
+	}
+	failing := map[string]bool{"insert_stmt": true, "drop_stmt": true}
+
+	for _, jobs := range []int{1, 4} {
+		t.Run(fmt.Sprintf("jobs=%d", jobs), func(t *testing.T) {
+			work := func(s stmtSpec) ([]byte, error) {
+				if failing[s.name] {
+					return nil, fmt.Errorf("%s: boom", s.name)
+				}
+				return []byte(s.name + " body"), nil
+			}
+
+			results, errs := runSpecPool(specList, jobs, false, work)
+
+			wantResultNames := []string{"alter_stmt", "create_stmt", "select_stmt"}
+			if len(results) != len(wantResultNames) {
+				t.Fatalf("got %d results, want %d: %+v", len(results), len(wantResultNames), results)
+			}
+			for i, r := range results {
+				if r.name != wantResultNames[i] {
+					t.Errorf("results[%d].name = %q, want %q (results not name-sorted: %v)", i, r.name, wantResultNames[i], results)
+				}
+				if string(r.body) != r.name+" body" {
+					t.Errorf("results[%d].body = %q, want %q", i, r.body, r.name+" body")
+				}
+			}
+
+			wantErrNames := []string{"drop_stmt", "insert_stmt"}
+			if len(errs) != len(wantErrNames) {
+				t.Fatalf("got %d errs, want %d: %+v", len(errs), len(wantErrNames), errs)
+			}
+			for i, e := range errs {
+				if e.name != wantErrNames[i] {
+					t.Errorf("errs[%d].name = %q, want %q (errs not name-sorted: %v)", i, e.name, wantErrNames[i], errs)
+				}
+			}
+		})
+	}
+}
+
+func TestRunSpecPoolEmpty(t *testing.T) {
+	results, errs := runSpecPool(nil, 4, false, func(s stmtSpec) ([]byte, error) {
+		t.Fatal("work should never be called for an empty spec list")
+		return nil, nil
+	})
+	if len(results) != 0 || len(errs) != 0 {
+		t.Errorf("got results=%v errs=%v, want both empty", results, errs)
+	}
+}